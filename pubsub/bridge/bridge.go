@@ -0,0 +1,285 @@
+// Package bridge exports a pubsub.Interface over a network connection, so that processes can share a topic
+// space.  It lives apart from pubsub itself so that the core package stays free of transport and encoding
+// dependencies.
+package bridge
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/swdunlop/pkg/pubsub"
+)
+
+// Kind identifies what a Frame represents.
+type Kind byte
+
+const (
+	// Publish carries a value to deliver to subscribers of Topic.
+	Publish Kind = iota
+
+	// Subscribe asks the peer to start forwarding Publish frames for Topic, tagged with ID.
+	Subscribe
+
+	// Unsubscribe asks the peer to stop forwarding Publish frames for the subscription named by ID.
+	Unsubscribe
+)
+
+// Frame is one message exchanged between a Bridge server and client.  Value is only meaningful for Publish
+// frames; ID is only meaningful for Subscribe and Unsubscribe frames.
+type Frame[T any] struct {
+	Kind  Kind
+	ID    string
+	Topic []string
+	Value T
+}
+
+// Codec reads and writes Frames on a connection.  Implementations own their own message boundaries (for
+// example, a length prefix for a raw stream, or native frame boundaries for a transport like WebSocket).
+type Codec[T any] interface {
+	WriteFrame(w io.Writer, f Frame[T]) error
+	ReadFrame(r io.Reader) (Frame[T], error)
+}
+
+// Handshaker is implemented by Codecs that need to negotiate something (such as an HTTP Upgrade) before
+// Frames can be written or read on a connection.  Serve and Dial call Handshake, if the codec has one,
+// before exchanging any Frames.
+type Handshaker interface {
+	// Handshake prepares conn for use as a Frame transport.  isServer is true when called from Serve.
+	Handshake(conn net.Conn, isServer bool) error
+}
+
+func handshake[T any](codec Codec[T], conn net.Conn, isServer bool) error {
+	hs, ok := codec.(Handshaker)
+	if !ok {
+		return nil
+	}
+	return hs.Handshake(conn, isServer)
+}
+
+// Serve accepts connections from listener and hooks each one into p: Subscribe and Unsubscribe frames from a
+// connection add and remove a subscription on p scoped to that connection, and Publish frames are applied to
+// p directly.  Values p delivers to a connection's subscriptions are written back as Publish frames.  Serve
+// blocks until listener.Accept fails, which happens when listener is closed.
+func Serve[T any](p pubsub.Interface[T], codec Codec[T], listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go serveConn(p, codec, conn)
+	}
+}
+
+func serveConn[T any](p pubsub.Interface[T], codec Codec[T], conn net.Conn) {
+	defer conn.Close()
+	if err := handshake(codec, conn, true); err != nil {
+		return
+	}
+
+	var writeMu sync.Mutex
+	writeFrame := func(f Frame[T]) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return codec.WriteFrame(conn, f)
+	}
+
+	var mu sync.Mutex
+	subs := make(map[string]*pubsub.Subscription[T])
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, sub := range subs {
+			sub.Cancel()
+		}
+	}()
+
+	for {
+		f, err := codec.ReadFrame(conn)
+		if err != nil {
+			return
+		}
+		switch f.Kind {
+		case Publish:
+			p.Publish(f.Value, f.Topic...)
+		case Subscribe:
+			sub, err := p.SubscribeWith(16, pubsub.Options{}, f.Topic...)
+			if err != nil {
+				continue
+			}
+			mu.Lock()
+			old, dup := subs[f.ID]
+			subs[f.ID] = sub
+			mu.Unlock()
+			if dup {
+				// A peer that reuses an ID would otherwise silently overwrite old's map entry, leaving it
+				// uncancelable and registered in p's router for the life of the connection.
+				old.Cancel()
+			}
+			go func(id string, topic []string, sub *pubsub.Subscription[T]) {
+				for v := range sub.Out() {
+					if writeFrame(Frame[T]{Kind: Publish, Topic: topic, Value: v}) != nil {
+						sub.Cancel()
+						return
+					}
+				}
+				mu.Lock()
+				// Only remove our own entry: if the ID was reused, subs[id] now belongs to the newer
+				// subscription, which must stay cancelable.
+				if subs[id] == sub {
+					delete(subs, id)
+				}
+				mu.Unlock()
+			}(f.ID, f.Topic, sub)
+		case Unsubscribe:
+			mu.Lock()
+			sub, ok := subs[f.ID]
+			delete(subs, f.ID)
+			mu.Unlock()
+			if ok {
+				sub.Cancel()
+			}
+		}
+	}
+}
+
+// Dial returns an Interface backed by conn: Publish sends a Publish frame to the peer, Subscribe and
+// SubscribeWith send a Subscribe frame and fan incoming Publish frames for matching topics out to local
+// subscriber channels, and Unsubscribe (or canceling a Subscription) sends an Unsubscribe frame.  As with
+// pubsub.New, running the returned Interface's Process is optional; Dial stops relaying frames once conn is
+// closed.
+func Dial[T any](codec Codec[T], conn net.Conn) (pubsub.Interface[T], error) {
+	if err := handshake(codec, conn, false); err != nil {
+		return nil, err
+	}
+
+	c := &client[T]{
+		local:  pubsub.New[T](),
+		codec:  codec,
+		conn:   conn,
+		legacy: make(map[legacyKey[T]]*pubsub.Subscription[T]),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+type legacyKey[T any] struct {
+	ch    chan<- T
+	topic string
+}
+
+func newLegacyKey[T any](ch chan<- T, topic []string) legacyKey[T] {
+	return legacyKey[T]{ch: ch, topic: strings.Join(topic, "\x00")}
+}
+
+type client[T any] struct {
+	local pubsub.Interface[T]
+	codec Codec[T]
+	conn  net.Conn
+
+	writeMu sync.Mutex
+
+	legacyMu sync.Mutex
+	legacy   map[legacyKey[T]]*pubsub.Subscription[T]
+}
+
+func (c *client[T]) writeFrame(f Frame[T]) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.codec.WriteFrame(c.conn, f)
+}
+
+func (c *client[T]) readLoop() {
+	defer c.conn.Close()
+	// c.local.Close also runs on the ordinary Close path, but that path is not guaranteed to be called: this
+	// ensures every Subscription made through c (including legacy forwarding goroutines) is still torn down
+	// when the peer drops the connection out from under us, matching serveConn's cleanup on the server side.
+	defer c.local.Close()
+	for {
+		f, err := c.codec.ReadFrame(c.conn)
+		if err != nil {
+			return
+		}
+		if f.Kind == Publish {
+			c.local.Publish(f.Value, f.Topic...)
+		}
+	}
+}
+
+func (c *client[T]) Process(exit <-chan struct{}) {
+	c.local.Process(exit)
+}
+
+// Close shuts down the local subscriber bookkeeping and the underlying connection.
+func (c *client[T]) Close() {
+	c.local.Close()
+	c.conn.Close()
+}
+
+func (c *client[T]) Publish(v T, topic ...string) {
+	_ = c.writeFrame(Frame[T]{Kind: Publish, Topic: topic, Value: v})
+}
+
+func (c *client[T]) Subscribe(ch chan<- T, topic ...string) error {
+	key := newLegacyKey(ch, topic)
+
+	// legacyMu is held across the whole check-then-insert, not just each half of it, so two goroutines racing
+	// to Subscribe the same (ch, topic) pair can't both pass the duplicate check, as in pubsub.config.Subscribe.
+	c.legacyMu.Lock()
+	defer c.legacyMu.Unlock()
+	if _, dup := c.legacy[key]; dup {
+		return pubsub.DuplicateSubscription{}
+	}
+
+	sub, err := c.SubscribeWith(0, pubsub.Options{}, topic...)
+	if err != nil {
+		return err
+	}
+	c.legacy[key] = sub
+
+	go func() {
+		for v := range sub.Out() {
+			select {
+			case ch <- v:
+			case <-sub.Canceled():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *client[T]) SubscribeWith(capacity int, opts pubsub.Options, topic ...string) (*pubsub.Subscription[T], error) {
+	sub, err := c.local.SubscribeWith(capacity, opts, topic...)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.writeFrame(Frame[T]{Kind: Subscribe, ID: sub.ID(), Topic: topic}); err != nil {
+		sub.Cancel()
+		return nil, err
+	}
+	sub.OnCancel(func() {
+		_ = c.writeFrame(Frame[T]{Kind: Unsubscribe, ID: sub.ID(), Topic: topic})
+	})
+	return sub, nil
+}
+
+func (c *client[T]) Unsubscribe(ch chan<- T, topic ...string) {
+	key := newLegacyKey(ch, topic)
+
+	c.legacyMu.Lock()
+	sub, ok := c.legacy[key]
+	if ok {
+		delete(c.legacy, key)
+	}
+	c.legacyMu.Unlock()
+	if !ok {
+		return
+	}
+	sub.Cancel()
+}
+
+// ErrHandshakeFailed is returned by a Codec's Handshake when the peer did not complete it as expected.
+var ErrHandshakeFailed = errors.New("bridge: handshake failed")
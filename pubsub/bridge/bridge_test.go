@@ -0,0 +1,125 @@
+package bridge
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/swdunlop/pkg/pubsub"
+)
+
+func TestGobCodecRoundTrip(t *testing.T) {
+	testCodecRoundTrip(t, GobCodec[string]{})
+}
+
+func TestJSONWebSocketCodecRoundTrip(t *testing.T) {
+	testCodecRoundTrip(t, JSONWebSocketCodec[string]{})
+}
+
+// testCodecRoundTrip hooks one end of a net.Pipe into a fresh pubsub instance with serveConn and Dials the
+// other end against it (each doing its own Handshake, if codec needs one), then checks that a value
+// published on either side reaches a subscriber on the other.
+func testCodecRoundTrip(t *testing.T, codec Codec[string]) {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	p := pubsub.New[string]()
+	defer p.Close()
+	go serveConn(p, codec, serverConn)
+
+	client, err := Dial(codec, clientConn)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+
+	sub, err := client.SubscribeWith(1, pubsub.Options{}, "t")
+	if err != nil {
+		t.Fatalf("SubscribeWith: %v", err)
+	}
+	fromServer := make(chan string, 1)
+	go func() {
+		for v := range sub.Out() {
+			fromServer <- v
+		}
+	}()
+
+	// Nothing acknowledges the Subscribe frame client.SubscribeWith just sent, so retry the publish against
+	// p until the subscription has actually taken effect on the server side or the deadline expires.
+	if !retryUntilReceived(t, fromServer, func() { p.Publish("server-to-client", "t") }) {
+		t.Fatal("timed out waiting for a server-side Publish to reach the client")
+	}
+
+	fromClient := make(chan string, 1)
+	if err := p.Subscribe(fromClient, "u"); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if !retryUntilReceived(t, fromClient, func() { client.Publish("client-to-server", "u") }) {
+		t.Fatal("timed out waiting for a client-side Publish to reach the server")
+	}
+}
+
+// retryUntilReceived calls send repeatedly until a value arrives on ch or the deadline expires, returning
+// whether one arrived.
+func retryUntilReceived(t *testing.T, ch <-chan string, send func()) bool {
+	t.Helper()
+	deadline := time.After(2 * time.Second)
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	send()
+	for {
+		select {
+		case <-ch:
+			return true
+		case <-ticker.C:
+			send()
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+func TestServeConnCancelsReusedSubscribeID(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	p := pubsub.New[string]()
+	defer p.Close()
+	codec := GobCodec[string]{}
+	go serveConn(p, codec, serverConn)
+
+	write := func(f Frame[string]) {
+		if err := codec.WriteFrame(clientConn, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(Frame[string]{Kind: Subscribe, ID: "dup", Topic: []string{"t"}})
+	write(Frame[string]{Kind: Subscribe, ID: "dup", Topic: []string{"t"}})
+
+	// Nothing acknowledges a Subscribe frame, so give serveConn time to process both before publishing.
+	time.Sleep(50 * time.Millisecond)
+	p.Publish("hello", "t")
+
+	if err := clientConn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	f, err := codec.ReadFrame(clientConn)
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if f.Kind != Publish || f.Value != "hello" {
+		t.Fatalf("got %+v, want a Publish frame carrying %q", f, "hello")
+	}
+
+	// If the first Subscribe's subscription hadn't been canceled when the ID was reused, a second Publish
+	// frame for the same value would already be queued behind the first one.
+	if err := clientConn.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codec.ReadFrame(clientConn); err == nil {
+		t.Fatal("got a second Publish frame, want the reused ID to have canceled the first subscription")
+	}
+}
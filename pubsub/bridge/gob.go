@@ -0,0 +1,54 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// maxFrameLen bounds how large a single length-prefixed frame is allowed to be, as a sanity check against a
+// corrupt or malicious length prefix.
+const maxFrameLen = 64 << 20
+
+// GobCodec encodes Frames with encoding/gob, each one length-prefixed so a frame boundary can always be found
+// again on a raw byte stream such as a TCP connection.
+type GobCodec[T any] struct{}
+
+// WriteFrame gob-encodes f and writes it to w behind a 4-byte big-endian length prefix.
+func (GobCodec[T]) WriteFrame(w io.Writer, f Frame[T]) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&f); err != nil {
+		return err
+	}
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(buf.Len()))
+	if _, err := w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ReadFrame reads a 4-byte big-endian length prefix from r, then gob-decodes that many bytes into a Frame.
+func (GobCodec[T]) ReadFrame(r io.Reader) (Frame[T], error) {
+	var zero Frame[T]
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return zero, err
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n > maxFrameLen {
+		return zero, fmt.Errorf("bridge: frame of %d bytes exceeds %d byte limit", n, maxFrameLen)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return zero, err
+	}
+	var f Frame[T]
+	if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(&f); err != nil {
+		return zero, err
+	}
+	return f, nil
+}
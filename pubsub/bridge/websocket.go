@@ -0,0 +1,255 @@
+package bridge
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+// websocketGUID is the magic value RFC 6455 defines for computing Sec-WebSocket-Accept from
+// Sec-WebSocket-Key.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// JSONWebSocketCodec encodes each Frame as JSON inside a single WebSocket frame.  It performs a minimal
+// RFC 6455 handshake and framing sufficient to interoperate with standards-compliant WebSocket peers, not
+// just this package's own Serve and Dial; it does not implement extensions, fragmentation, or ping/pong.
+type JSONWebSocketCodec[T any] struct{}
+
+// serverConns tracks, per connection, whether this side of it performed the handshake as the server, so
+// WriteFrame can mask only client-to-server frames as RFC 6455 §5.1 requires; a compliant peer (any browser,
+// gorilla/websocket, etc.) closes the connection on receiving a masked frame from the server. A Codec value
+// is shared across every connection Serve or Dial hands it, so this can't simply be a field on it.
+var serverConns sync.Map // net.Conn -> bool
+
+// Handshake performs the WebSocket opening handshake over conn: an HTTP/1.1 Upgrade request and response
+// exchanged by hand, since conn is a bare net.Conn rather than an *http.Server connection.
+func (JSONWebSocketCodec[T]) Handshake(conn net.Conn, isServer bool) error {
+	serverConns.Store(conn, isServer)
+	if isServer {
+		return acceptWebSocket(conn)
+	}
+	return requestWebSocket(conn)
+}
+
+func acceptWebSocket(conn net.Conn) error {
+	var key string
+	for {
+		line, err := readHTTPLine(conn)
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(name), "Sec-WebSocket-Key") {
+			key = strings.TrimSpace(value)
+		}
+	}
+	if key == "" {
+		return fmt.Errorf("%w: no Sec-WebSocket-Key in request", ErrHandshakeFailed)
+	}
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + webSocketAccept(key) + "\r\n\r\n"
+	_, err := conn.Write([]byte(response))
+	return err
+}
+
+func requestWebSocket(conn net.Conn) error {
+	var rawKey [16]byte
+	if _, err := rand.Read(rawKey[:]); err != nil {
+		return err
+	}
+	key := base64.StdEncoding.EncodeToString(rawKey[:])
+	request := "GET / HTTP/1.1\r\n" +
+		"Host: bridge\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + key + "\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(request)); err != nil {
+		return err
+	}
+	var accept string
+	for {
+		line, err := readHTTPLine(conn)
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(name), "Sec-WebSocket-Accept") {
+			accept = strings.TrimSpace(value)
+		}
+	}
+	if accept != webSocketAccept(key) {
+		return fmt.Errorf("%w: unexpected Sec-WebSocket-Accept", ErrHandshakeFailed)
+	}
+	return nil
+}
+
+func webSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// readHTTPLine reads a single CRLF-terminated line one byte at a time, so it never reads past the blank line
+// ending the HTTP handshake and into the WebSocket frames that follow on the same connection.
+func readHTTPLine(conn net.Conn) (string, error) {
+	var line []byte
+	var b [1]byte
+	for {
+		if _, err := conn.Read(b[:]); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return strings.TrimRight(string(line), "\r"), nil
+		}
+		line = append(line, b[0])
+	}
+}
+
+// WriteFrame JSON-encodes f and writes it as a single WebSocket text frame, masked unless this connection
+// performed the handshake as the server.
+func (JSONWebSocketCodec[T]) WriteFrame(w io.Writer, f Frame[T]) error {
+	payload, err := json.Marshal(&f)
+	if err != nil {
+		return err
+	}
+	mask := true
+	if conn, ok := w.(net.Conn); ok {
+		if isServer, ok := serverConns.Load(conn); ok {
+			mask = !isServer.(bool)
+		}
+	}
+	return writeWebSocketFrame(w, payload, mask)
+}
+
+// ReadFrame reads a single WebSocket frame from r and JSON-decodes its payload into a Frame.
+func (JSONWebSocketCodec[T]) ReadFrame(r io.Reader) (Frame[T], error) {
+	var zero Frame[T]
+	payload, err := readWebSocketFrame(r)
+	if err != nil {
+		if conn, ok := r.(net.Conn); ok {
+			serverConns.Delete(conn)
+		}
+		return zero, err
+	}
+	var f Frame[T]
+	if err := json.Unmarshal(payload, &f); err != nil {
+		return zero, err
+	}
+	return f, nil
+}
+
+const opcodeText = 0x1
+
+func writeWebSocketFrame(w io.Writer, payload []byte, mask bool) error {
+	var header []byte
+	header = append(header, 0x80|opcodeText)
+
+	var maskBit byte
+	if mask {
+		maskBit = 0x80
+	}
+
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, maskBit|byte(n))
+	case n <= 0xffff:
+		var length [2]byte
+		binary.BigEndian.PutUint16(length[:], uint16(n))
+		header = append(header, maskBit|126)
+		header = append(header, length[:]...)
+	default:
+		var length [8]byte
+		binary.BigEndian.PutUint64(length[:], uint64(n))
+		header = append(header, maskBit|127)
+		header = append(header, length[:]...)
+	}
+
+	if !mask {
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		_, err := w.Write(payload)
+		return err
+	}
+
+	var maskKey [4]byte
+	if _, err := rand.Read(maskKey[:]); err != nil {
+		return err
+	}
+	header = append(header, maskKey[:]...)
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	masked := make([]byte, len(payload))
+	for i, c := range payload {
+		masked[i] = c ^ maskKey[i%4]
+	}
+	_, err := w.Write(masked)
+	return err
+}
+
+// readWebSocketFrame reads exactly one frame from r using io.ReadFull for each piece, so it never reads past
+// the frame's own payload and into whatever the peer sends next on the same connection.
+func readWebSocketFrame(r io.Reader) ([]byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	opcode := header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(r, extended[:]); err != nil {
+			return nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(r, extended[:]); err != nil {
+			return nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+
+	if opcode != opcodeText {
+		return nil, fmt.Errorf("bridge: unsupported WebSocket opcode %#x", opcode)
+	}
+	if length > maxFrameLen {
+		return nil, fmt.Errorf("bridge: frame of %d bytes exceeds %d byte limit", length, maxFrameLen)
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return payload, nil
+}
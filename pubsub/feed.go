@@ -0,0 +1,154 @@
+package pubsub
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Feed implements one-to-many typed broadcast, modeled after go-ethereum's event.Feed.  Unlike Interface,
+// which is topic-routed and lossy by design, Feed has no topics and Send blocks until every subscriber
+// present at the time of the call has received the value.  The zero value is ready to use.
+type Feed[T any] struct {
+	mu   sync.Mutex
+	subs map[*feedSubscription[T]]struct{}
+}
+
+// Subscribe adds ch as a subscriber.  Every value passed to Send after this call returns will be delivered
+// to ch until the returned Subscription is unsubscribed.
+func (f *Feed[T]) Subscribe(ch chan<- T) *FeedSubscription[T] {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subs == nil {
+		f.subs = make(map[*feedSubscription[T]]struct{})
+	}
+	sub := &feedSubscription[T]{
+		feed:   f,
+		ch:     ch,
+		err:    make(chan error),
+		closed: make(chan struct{}),
+	}
+	f.subs[sub] = struct{}{}
+	return &FeedSubscription[T]{sub: sub}
+}
+
+// Send delivers v to every subscriber currently on the feed, blocking until each of them has received it or
+// unsubscribed, and returns how many subscribers received it.
+func (f *Feed[T]) Send(v T) int {
+	f.mu.Lock()
+	subs := make([]*feedSubscription[T], 0, len(f.subs))
+	for sub := range f.subs {
+		subs = append(subs, sub)
+	}
+	f.mu.Unlock()
+
+	if len(subs) == 0 {
+		return 0
+	}
+
+	// Each subscriber contributes two select cases: sending v, and being told it unsubscribed mid-Send.
+	// Whichever fires first removes both of that subscriber's cases and, if it was the send, counts as
+	// delivered. reflect.Select is used because the set of destination channels is only known at runtime.
+	cases := make([]reflect.SelectCase, 0, 2*len(subs))
+	for _, sub := range subs {
+		cases = append(cases,
+			reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(sub.ch), Send: reflect.ValueOf(v)},
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(sub.closed)},
+		)
+	}
+
+	delivered := 0
+	for len(cases) > 0 {
+		chosen, _, _ := reflect.Select(cases)
+		if chosen%2 == 0 {
+			delivered++
+		}
+		pair := chosen / 2
+		cases = append(cases[:2*pair], cases[2*pair+2:]...)
+	}
+	return delivered
+}
+
+func (f *Feed[T]) remove(sub *feedSubscription[T]) {
+	f.mu.Lock()
+	delete(f.subs, sub)
+	f.mu.Unlock()
+}
+
+type feedSubscription[T any] struct {
+	feed   *Feed[T]
+	ch     chan<- T
+	err    chan error
+	closed chan struct{}
+	once   sync.Once
+}
+
+// FeedSubscription is returned by Feed.Subscribe.  Its shape mirrors go-ethereum's Subscription: Unsubscribe
+// stops delivery, and Err reports why, closing without a value for an ordinary Unsubscribe.
+type FeedSubscription[T any] struct {
+	sub *feedSubscription[T]
+}
+
+// Unsubscribe stops delivery to this subscriber's channel.  It is safe to call more than once.
+func (s *FeedSubscription[T]) Unsubscribe() {
+	s.sub.once.Do(func() {
+		s.sub.feed.remove(s.sub)
+		close(s.sub.closed)
+		close(s.sub.err)
+	})
+}
+
+// Err returns a channel that is closed when the subscription ends.  A future error value, if any, would be
+// sent on it before the close; an ordinary Unsubscribe just closes it.
+func (s *FeedSubscription[T]) Err() <-chan error {
+	return s.sub.err
+}
+
+// FeedSubscriber is implemented by *FeedSubscription[T] for every T.  SubscriptionScope batches this
+// interface rather than a concrete *FeedSubscription[T], so a single scope can track subscriptions from
+// Feeds of different element types, mirroring go-ethereum's event.SubscriptionScope: its usual use case is a
+// component with several Feed[A], Feed[B], ... wanting one shutdown path. It is named FeedSubscriber, not
+// Subscription, to avoid colliding with the unrelated Subscription[T] already exported by this package for
+// Interface's topic-routed subscriptions.
+type FeedSubscriber interface {
+	Unsubscribe()
+	Err() <-chan error
+}
+
+// SubscriptionScope batches a group of FeedSubscribers so they can all be torn down together, for example
+// when the component that created them shuts down.  The zero value is ready to use.
+type SubscriptionScope struct {
+	mu     sync.Mutex
+	subs   map[FeedSubscriber]struct{}
+	closed bool
+}
+
+// Track adds sub to the scope and returns it, unless the scope is already closed, in which case sub is
+// unsubscribed immediately.
+func (sc *SubscriptionScope) Track(sub FeedSubscriber) FeedSubscriber {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.closed {
+		sub.Unsubscribe()
+		return sub
+	}
+	if sc.subs == nil {
+		sc.subs = make(map[FeedSubscriber]struct{})
+	}
+	sc.subs[sub] = struct{}{}
+	return sub
+}
+
+// Close unsubscribes every tracked subscription.  Subsequent calls to Track unsubscribe immediately instead
+// of being tracked.  Close itself is safe to call more than once.
+func (sc *SubscriptionScope) Close() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.closed {
+		return
+	}
+	sc.closed = true
+	for sub := range sc.subs {
+		sub.Unsubscribe()
+	}
+	sc.subs = nil
+}
@@ -0,0 +1,120 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFeedSendDeliversToEverySubscriber(t *testing.T) {
+	var f Feed[int]
+
+	chA := make(chan int)
+	chB := make(chan int)
+	subA := f.Subscribe(chA)
+	subB := f.Subscribe(chB)
+	defer subA.Unsubscribe()
+	defer subB.Unsubscribe()
+
+	done := make(chan int)
+	go func() { done <- f.Send(42) }()
+
+	got := make(map[int]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case v := <-chA:
+			got[v] = true
+			chA = nil // already received; stop selecting on it
+		case v := <-chB:
+			got[v] = true
+			chB = nil
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for both subscribers to receive the value")
+		}
+	}
+	if len(got) != 1 || !got[42] {
+		t.Fatalf("got %v, want both subscribers to receive 42", got)
+	}
+
+	select {
+	case n := <-done:
+		if n != 2 {
+			t.Fatalf("Send returned %d, want 2", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Send did not return after every subscriber received the value")
+	}
+}
+
+func TestFeedSendSkipsSubscriberThatUnsubscribesMidSend(t *testing.T) {
+	var f Feed[int]
+
+	ch := make(chan int) // never drained
+	sub := f.Subscribe(ch)
+
+	done := make(chan int)
+	go func() { done <- f.Send(1) }()
+
+	// Send is now blocked trying to deliver to ch; Unsubscribe should free it up rather than stall Send
+	// forever on a subscriber that is going away.
+	time.Sleep(10 * time.Millisecond)
+	sub.Unsubscribe()
+
+	select {
+	case n := <-done:
+		if n != 0 {
+			t.Fatalf("Send returned %d, want 0 (its only subscriber unsubscribed mid-Send)", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Send did not return after its only subscriber unsubscribed")
+	}
+}
+
+func TestFeedSendWithNoSubscribers(t *testing.T) {
+	var f Feed[int]
+	if n := f.Send(1); n != 0 {
+		t.Fatalf("Send returned %d, want 0", n)
+	}
+}
+
+func TestSubscriptionScopeTracksDifferentFeedTypes(t *testing.T) {
+	var ints Feed[int]
+	var strs Feed[string]
+	var scope SubscriptionScope
+
+	// A single scope should be able to batch subscriptions from Feeds of different element types, the usual
+	// go-ethereum event.SubscriptionScope use case this mirrors.
+	subInt := scope.Track(ints.Subscribe(make(chan int)))
+	subStr := scope.Track(strs.Subscribe(make(chan string)))
+	scope.Close()
+
+	for _, sub := range []FeedSubscriber{subInt, subStr} {
+		select {
+		case <-sub.Err():
+		case <-time.After(time.Second):
+			t.Fatal("expected Err to close once the scope was closed")
+		}
+	}
+}
+
+func TestSubscriptionScopeClose(t *testing.T) {
+	var f Feed[int]
+	var scope SubscriptionScope
+
+	sub := scope.Track(f.Subscribe(make(chan int)))
+	scope.Close()
+
+	select {
+	case <-sub.Err():
+	case <-time.After(time.Second):
+		t.Fatal("expected Err to close once the scope was closed")
+	}
+
+	// A Subscription tracked after Close should be unsubscribed immediately rather than leak into a scope
+	// nobody will Close again.
+	sub2 := scope.Track(f.Subscribe(make(chan int)))
+	select {
+	case <-sub2.Err():
+	case <-time.After(time.Second):
+		t.Fatal("expected a Subscription tracked after Close to be unsubscribed immediately")
+	}
+}
@@ -0,0 +1,45 @@
+package pubsub
+
+import (
+	"errors"
+	"time"
+)
+
+// Policy controls how Publish behaves when a subscriber's channel is not ready to receive a value.
+type Policy int
+
+const (
+	// DropNewest discards the value currently being published when the subscriber's channel is full. This
+	// matches the package's original, implicit behavior and remains the default for Subscribe.
+	DropNewest Policy = iota
+
+	// DropOldest makes room for the new value by discarding the oldest value still buffered for the
+	// subscriber, then delivers the new value.
+	DropOldest
+
+	// Block waits for the subscriber to make room, up to Options.Timeout if it is non-zero. A zero Timeout
+	// waits forever.
+	Block
+
+	// EvictOnOverflow unsubscribes and closes the subscriber's channel instead of dropping the value,
+	// recording ErrOutOfCapacity on its Subscription.
+	EvictOnOverflow
+)
+
+// Options configures how Publish treats a subscriber added with SubscribeWith.
+type Options struct {
+	// Policy selects the backpressure behavior applied when the subscriber's channel is full.
+	Policy Policy
+
+	// Timeout bounds how long the Block policy will wait before giving up. Zero means wait forever. Ignored
+	// by every other Policy.
+	Timeout time.Duration
+}
+
+// ErrOutOfCapacity is recorded on a Subscription's Err when EvictOnOverflow unsubscribes a subscriber that
+// could not keep up with publishing.
+var ErrOutOfCapacity = errors.New("pubsub: subscriber out of capacity")
+
+// ErrClosed is recorded on a Subscription's Err when it ends because the pubsub instance it belongs to was
+// Closed, as opposed to the subscriber calling Cancel (or Unsubscribe) itself.
+var ErrClosed = errors.New("pubsub: closed")
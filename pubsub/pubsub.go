@@ -1,165 +1,414 @@
 // Package pubsub provides a simple publish/subscribe mechanism for a generic type using a radix tree of topics.
 package pubsub
 
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
 // New creates a new pubsub instance for a generic type.
 func New[T any]() Interface[T] {
 	return &config[T]{
-		publish:     make(chan publish[T]),
-		subscribe:   make(chan subscribe[T]),
-		unsubscribe: make(chan unsubscribe[T]),
+		root:   newRouterNode[T](),
+		legacy: make(map[legacyKey[T]]*Subscription[T]),
+		closed: make(chan struct{}),
 	}
 }
 
 // Interface is a simple publish/subscribe mechanism for a generic type using a radix tree of topics.
 type Interface[T any] interface {
-	// Process starts the pubsub instance.  It will block until the exit channel is closed.
+	// Process is only needed if you want shutdown tied to an exit channel rather than calling Close
+	// directly: it blocks until exit is closed, then calls Close, and returns early if Close has already been
+	// called.  It is otherwise optional, since Publish, Subscribe, and SubscribeWith all work without it.
 	Process(exit <-chan struct{})
 
-	// Publish sends a value to all subscribers for any published value starting with the given topic.  Any
-	// subscribers that are not ready to receive the value will be skipped.
+	// Publish delivers a value to every subscriber for any published value starting with the given topic.
+	// It returns as soon as the value has been handed to, or dropped for, every current subscriber: it does
+	// not wait for Subscribe or Unsubscribe calls racing with it, and subscribers using the Block policy may
+	// still make it wait on them individually.
 	Publish(v T, topic ...string)
 
 	// Subscribe adds a subscriber channel for any published value starting with the given topic.  Returns
-	// DuplicateSubscription if the channel is already subscribed to the topic.
+	// DuplicateSubscription if the channel is already subscribed to the topic.  Subscribers added this way
+	// use the DropNewest policy: a value is silently skipped if the channel is not ready to receive it.  This
+	// is a compatibility wrapper around SubscribeWith for callers that do not need a Subscription handle.
 	Subscribe(ch chan<- T, topic ...string) error
 
+	// SubscribeWith adds a subscriber for any published value starting with the given topic, allocating a
+	// delivery channel of the given capacity and applying opts to control backpressure.  A "*" segment in
+	// topic matches exactly one published topic component, and a "**" (or ">") segment matches that
+	// component and every one after it, including none.  It returns a Subscription handle with a unique ID,
+	// which may be used to Cancel the subscription or to discover why delivery stopped.  Because each call
+	// allocates its own channel and ID, the same logical subscriber may SubscribeWith multiple topics without
+	// ever seeing DuplicateSubscription.
+	SubscribeWith(capacity int, opts Options, topic ...string) (*Subscription[T], error)
+
 	// Unsubscribe removes a subscriber channel for any published value starting with the given topic.  This
 	// should match the original channel passed to Subscribe.  Does nothing if there is no subscriber.
 	// The channel will be closed when it is unsubscribed.
 	Unsubscribe(ch chan<- T, topic ...string)
+
+	// Close unsubscribes every current subscriber, closing each Subscription's Out channel exactly once.  A
+	// channel passed to Subscribe is not closed: Close only stops forwarding values to it.  It is safe to
+	// call more than once, including concurrently with Publish, Subscribe, and Unsubscribe.
+	Close()
 }
 
 type config[T any] struct {
-	publish     chan publish[T]
-	subscribe   chan subscribe[T]
-	unsubscribe chan unsubscribe[T]
+	// mu guards root.  Publish only needs to read the tree to find who to deliver to, so it takes the read
+	// lock and can run concurrently with every other Publish; Subscribe, Unsubscribe, and Close mutate the
+	// tree and take the write lock.
+	mu   sync.RWMutex
+	root *router[T]
+
+	// legacyMu guards legacy, which lets Subscribe/Unsubscribe recover the Subscription backing a (ch, topic)
+	// pair, since those methods predate Subscription and only ever hand the caller back their own channel.
+	legacyMu sync.Mutex
+	legacy   map[legacyKey[T]]*Subscription[T]
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// legacyKey identifies a subscription made through the compatibility Subscribe method.
+type legacyKey[T any] struct {
+	ch    chan<- T
+	topic string
+}
+
+func newLegacyKey[T any](ch chan<- T, topic []string) legacyKey[T] {
+	return legacyKey[T]{ch: ch, topic: strings.Join(topic, "\x00")}
 }
 
 func (cfg *config[T]) Process(exit <-chan struct{}) {
-	rr := router[T]{
-		subscribers: make(map[chan<- T]struct{}),
-		topics:      make(map[string]router[T]),
-	}
-	for {
-		select {
-		case p := <-cfg.publish:
-			rr.publish(p.v, p.topic...)
-			close(p.done)
-		case s := <-cfg.subscribe:
-			err := rr.subscribe(s.ch, s.topic...)
-			s.done <- err
-		case u := <-cfg.unsubscribe:
-			rr.unsubscribe(u.ch, u.topic...)
-			close(u.done)
-		case <-exit:
-			rr.close(make(map[chan<- T]struct{}))
-			return
-		}
+	select {
+	case <-exit:
+	case <-cfg.closed:
+		return
 	}
+	cfg.Close()
 }
 
 func (cfg *config[T]) Publish(v T, topic ...string) {
-	done := make(chan struct{})
-	cfg.publish <- publish[T]{topic, v, done}
-	<-done
+	cfg.mu.RLock()
+	entries := cfg.root.collect(topic, nil)
+	cfg.mu.RUnlock()
+
+	for _, e := range entries {
+		cfg.deliver(e.id, v, e.rec)
+	}
 }
 
 func (cfg *config[T]) Subscribe(ch chan<- T, topic ...string) error {
-	done := make(chan error)
-	cfg.subscribe <- subscribe[T]{topic, ch, done}
-	return <-done
+	key := newLegacyKey(ch, topic)
+
+	// legacyMu is held across the whole check-then-insert, not just each half of it, so two goroutines
+	// racing to Subscribe the same (ch, topic) pair can't both pass the duplicate check.
+	cfg.legacyMu.Lock()
+	defer cfg.legacyMu.Unlock()
+	if _, dup := cfg.legacy[key]; dup {
+		return DuplicateSubscription{}
+	}
+
+	// The relay channel's capacity, not ch's, is what DropNewest actually delivers against, so it must match
+	// cap(ch) or an otherwise-idle, buffered ch would only receive while the forwarding goroutine below
+	// happens to be parked on its own send.
+	sub, err := cfg.SubscribeWith(cap(ch), Options{}, topic...)
+	if err != nil {
+		return err
+	}
+	cfg.legacy[key] = sub
+
+	go func() {
+		for v := range sub.Out() {
+			select {
+			case ch <- v:
+			case <-sub.Canceled():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (cfg *config[T]) SubscribeWith(capacity int, opts Options, topic ...string) (*Subscription[T], error) {
+	sub := newSubscription[T](capacity, topic)
+	sub.cfg = cfg
+	rec := subscriberRecord[T]{
+		ch:   sub.ch,
+		opts: opts,
+		sub:  sub,
+		pop: func() (T, bool) {
+			select {
+			case v := <-sub.ch:
+				return v, true
+			default:
+				var zero T
+				return zero, false
+			}
+		},
+	}
+
+	cfg.mu.Lock()
+	select {
+	case <-cfg.closed:
+		cfg.mu.Unlock()
+		return nil, ErrClosed
+	default:
+	}
+	err := cfg.root.subscribe(rec, topic...)
+	cfg.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
 }
 
 func (cfg *config[T]) Unsubscribe(ch chan<- T, topic ...string) {
-	done := make(chan struct{})
-	cfg.unsubscribe <- unsubscribe[T]{topic, ch, done}
-	<-done
+	key := newLegacyKey(ch, topic)
+
+	cfg.legacyMu.Lock()
+	sub, ok := cfg.legacy[key]
+	if ok {
+		delete(cfg.legacy, key)
+	}
+	cfg.legacyMu.Unlock()
+	if !ok {
+		return
+	}
+	sub.Cancel()
 }
 
-type publish[T any] struct {
-	topic []string
-	v     T
-	done  chan struct{}
+func (cfg *config[T]) Close() {
+	cfg.closeOnce.Do(func() {
+		// closed is closed inside this same critical section, not after, so it's never possible for
+		// SubscribeWith to check closed, see it still open, and then register into root after the swap below:
+		// the two either serialize with SubscribeWith entirely before this lock (and so are collected by
+		// collectAll here) or entirely after it (and so see closed and refuse to register at all).
+		cfg.mu.Lock()
+		entries := cfg.root.collectAll(nil)
+		cfg.root = newRouterNode[T]()
+		close(cfg.closed)
+		cfg.mu.Unlock()
+
+		// terminate waits for any deliver in flight on sub (sendMu) before it can close sub's channel, and a
+		// Block subscriber with no Timeout may never release that lock on its own. Terminating on a goroutine
+		// per subscriber keeps one wedged subscriber from stalling Close for every other subscriber.
+		var wg sync.WaitGroup
+		wg.Add(len(entries))
+		for _, e := range entries {
+			go func(sub *Subscription[T]) {
+				defer wg.Done()
+				sub.terminate(ErrClosed)
+			}(e.rec.sub)
+		}
+		wg.Wait()
+	})
 }
 
-type subscribe[T any] struct {
-	topic []string
-	ch    chan<- T
-	done  chan error
+// cancel removes sub from the tree and terminates it.  It is called by Subscription.Cancel.
+func (cfg *config[T]) cancel(sub *Subscription[T]) {
+	cfg.mu.Lock()
+	cfg.root.remove(sub.id, sub.topic...)
+	cfg.mu.Unlock()
+	sub.terminate(nil)
 }
 
-type unsubscribe[T any] struct {
-	topic []string
-	ch    chan<- T
-	done  chan struct{}
+// deliver sends v to rec's channel according to its Policy, falling back to that policy only when the
+// channel is not immediately ready to receive.  It never holds cfg.mu, so a subscriber blocked on the Block
+// policy cannot stall unrelated Subscribe or Unsubscribe calls.
+//
+// It does hold rec.sub.sendMu for as long as it might write to rec.ch, since terminate (Cancel, eviction, or
+// Close) can run concurrently from another goroutine and closes that same channel: sendMu's read lock here,
+// against terminate's write lock, keeps a send from ever racing a close.
+func (cfg *config[T]) deliver(id string, v T, rec subscriberRecord[T]) {
+	sub := rec.sub
+	sub.sendMu.RLock()
+	if sub.isTerminated() {
+		sub.sendMu.RUnlock()
+		return
+	}
+
+	select {
+	case rec.ch <- v:
+		sub.sendMu.RUnlock()
+		return
+	default:
+	}
+	switch rec.opts.Policy {
+	case Block:
+		if rec.opts.Timeout <= 0 {
+			rec.ch <- v
+			sub.sendMu.RUnlock()
+			return
+		}
+		timer := time.NewTimer(rec.opts.Timeout)
+		select {
+		case rec.ch <- v:
+		case <-timer.C:
+		}
+		timer.Stop()
+		sub.sendMu.RUnlock()
+	case DropOldest:
+		if rec.pop != nil {
+			if _, ok := rec.pop(); ok {
+				select {
+				case rec.ch <- v:
+				default:
+				}
+			}
+		}
+		sub.sendMu.RUnlock()
+	case EvictOnOverflow:
+		sub.sendMu.RUnlock()
+		cfg.evict(id, rec)
+	case DropNewest:
+		// the value is simply skipped
+		sub.sendMu.RUnlock()
+	}
+}
+
+// evict removes a subscriber that could not keep up, recording ErrOutOfCapacity on its Subscription.
+func (cfg *config[T]) evict(id string, rec subscriberRecord[T]) {
+	cfg.mu.Lock()
+	cfg.root.remove(id, rec.sub.topic...)
+	cfg.mu.Unlock()
+	rec.sub.terminate(ErrOutOfCapacity)
+}
+
+// subscriberRecord tracks everything needed to deliver to, and if necessary evict, a subscriber.
+type subscriberRecord[T any] struct {
+	ch   chan<- T
+	opts Options
+	sub  *Subscription[T]
+	// pop drains one buffered value from the subscriber's channel to make room under the DropOldest policy.
+	pop func() (T, bool)
+}
+
+// subscriberEntry pairs a subscriberRecord with the ID it is stored under, for code that walks the tree and
+// acts on what it finds after releasing the lock that protected the walk.
+type subscriberEntry[T any] struct {
+	id  string
+	rec subscriberRecord[T]
 }
 
 type router[T any] struct {
-	subscribers map[chan<- T]struct{}
-	topics      map[string]router[T]
+	subscribers map[string]subscriberRecord[T]
+	topics      map[string]*router[T]
+
+	// wildcard, if non-nil, holds subscribers registered with a "*" segment in place of topics[0]: it
+	// matches exactly one topic component, whatever it is.
+	wildcard *router[T]
+
+	// multiWildcard, if non-nil, holds subscribers registered with a "**" (or ">") segment in place of
+	// topics[0]: it matches that component and every component after it, including none at all. Any
+	// subscribed segments after "**" are ignored, since it is meant to be the last segment of a topic.
+	multiWildcard *router[T]
 }
 
-func (r *router[T]) subscribe(ch chan<- T, topic ...string) error {
+func newRouterNode[T any]() *router[T] {
+	return &router[T]{
+		subscribers: make(map[string]subscriberRecord[T]),
+		topics:      make(map[string]*router[T]),
+	}
+}
+
+func (r *router[T]) subscribe(rec subscriberRecord[T], topic ...string) error {
 	if len(topic) == 0 {
-		_, dup := r.subscribers[ch]
+		_, dup := r.subscribers[rec.sub.ID()]
 		if dup {
 			return DuplicateSubscription{}
 		}
-		r.subscribers[ch] = struct{}{}
+		r.subscribers[rec.sub.ID()] = rec
 		return nil
 	}
-	r2, ok := r.topics[topic[0]]
-	if !ok {
-		r2 = router[T]{
-			subscribers: make(map[chan<- T]struct{}),
-			topics:      make(map[string]router[T]),
+	switch topic[0] {
+	case "*":
+		if r.wildcard == nil {
+			r.wildcard = newRouterNode[T]()
 		}
-		r.topics[topic[0]] = r2
+		return r.wildcard.subscribe(rec, topic[1:]...)
+	case "**", ">":
+		if r.multiWildcard == nil {
+			r.multiWildcard = newRouterNode[T]()
+		}
+		return r.multiWildcard.subscribe(rec)
+	default:
+		// topics stores *router[T] rather than router[T] so that r2 here is the same node r.topics[topic[0]]
+		// already holds: subscribing a "*" or "**" segment further down mutates r2's wildcard or
+		// multiWildcard pointer fields, which a value copy pulled out of the map would lose.
+		r2, ok := r.topics[topic[0]]
+		if !ok {
+			r2 = newRouterNode[T]()
+			r.topics[topic[0]] = r2
+		}
+		return r2.subscribe(rec, topic[1:]...)
 	}
-	return r2.subscribe(ch, topic[1:]...)
 }
 
-func (r *router[T]) unsubscribe(ch chan<- T, topics ...string) {
-	if len(topics) == 0 {
-		delete(r.subscribers, ch)
+// remove deletes the subscriber with the given id at the node identified by topic, if any.  It only mutates
+// the tree; the caller is responsible for terminating the Subscription once it has released cfg.mu.
+func (r *router[T]) remove(id string, topic ...string) {
+	if len(topic) == 0 {
+		delete(r.subscribers, id)
 		return
 	}
-	r2, ok := r.topics[topics[0]]
-	if !ok {
-		return
+	switch topic[0] {
+	case "*":
+		if r.wildcard != nil {
+			r.wildcard.remove(id, topic[1:]...)
+		}
+	case "**", ">":
+		if r.multiWildcard != nil {
+			r.multiWildcard.remove(id)
+		}
+	default:
+		r2, ok := r.topics[topic[0]]
+		if !ok {
+			return
+		}
+		r2.remove(id, topic[1:]...)
 	}
-	r2.unsubscribe(ch, topics[1:]...)
 }
 
-func (r *router[T]) publish(v T, topics ...string) {
-	for ch := range r.subscribers {
-		select {
-		case ch <- v:
-		default:
+// collect gathers every subscriberRecord that a Publish for topics would deliver to, appending to out.
+func (r *router[T]) collect(topics []string, out []subscriberEntry[T]) []subscriberEntry[T] {
+	for id, rec := range r.subscribers {
+		out = append(out, subscriberEntry[T]{id, rec})
+	}
+	if r.multiWildcard != nil {
+		for id, rec := range r.multiWildcard.subscribers {
+			out = append(out, subscriberEntry[T]{id, rec})
 		}
 	}
 	if len(topics) == 0 {
-		return
+		return out
 	}
-	r2, ok := r.topics[topics[0]]
-	if !ok {
-		return
+	if r2, ok := r.topics[topics[0]]; ok {
+		out = r2.collect(topics[1:], out)
 	}
-	r2.publish(v, topics[1:]...)
+	if r.wildcard != nil {
+		out = r.wildcard.collect(topics[1:], out)
+	}
+	return out
 }
 
-func (r *router[T]) close(closed map[chan<- T]struct{}) {
-	for ch := range r.subscribers {
-		_, dup := closed[ch]
-		if dup {
-			continue
-		}
-		closed[ch] = struct{}{}
-		close(ch)
+// collectAll gathers every subscriberRecord anywhere in the tree, for Close.
+func (r *router[T]) collectAll(out []subscriberEntry[T]) []subscriberEntry[T] {
+	for id, rec := range r.subscribers {
+		out = append(out, subscriberEntry[T]{id, rec})
 	}
 	for _, r2 := range r.topics {
-		r2.close(closed)
+		out = r2.collectAll(out)
+	}
+	if r.wildcard != nil {
+		out = r.wildcard.collectAll(out)
+	}
+	if r.multiWildcard != nil {
+		out = r.multiWildcard.collectAll(out)
 	}
+	return out
 }
 
 // DuplicateSubscription is an error returned when a channel is already subscribed.
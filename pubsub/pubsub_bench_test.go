@@ -0,0 +1,290 @@
+package pubsub
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// publishBenchCase is shared between BenchmarkPublish and BenchmarkPublishLegacy so the two report numbers
+// for identical workloads.  publishers is passed to b.SetParallelism, so the number of publishing goroutines
+// is publishers × GOMAXPROCS.
+type publishBenchCase struct {
+	publishers, subscribers, topics int
+}
+
+var publishBenchCases = []publishBenchCase{
+	{publishers: 1, subscribers: 1, topics: 1},
+	{publishers: 4, subscribers: 100, topics: 10},
+	{publishers: 16, subscribers: 1000, topics: 50},
+}
+
+func benchCaseName(c publishBenchCase) string {
+	return fmt.Sprintf("publishers=%d/subscribers=%d/topics=%d", c.publishers, c.subscribers, c.topics)
+}
+
+// benchBroker is the subset of Interface that runPublishBenchmark needs; legacyConfig below implements it
+// without satisfying the rest of Interface (it predates Subscription.Cancel and Close).
+type benchBroker interface {
+	SubscribeWith(capacity int, opts Options, topic ...string) (*Subscription[int], error)
+	Publish(v int, topic ...string)
+}
+
+// BenchmarkPublish measures Publish throughput across a range of publisher, subscriber, and topic counts, to
+// gauge how the RWMutex-based router behaves under contention compared to the single-goroutine
+// channel-based design it replaced (see BenchmarkPublishLegacy for the same workload run against that
+// design, e.g. with benchstat).
+func BenchmarkPublish(b *testing.B) {
+	for _, c := range publishBenchCases {
+		b.Run(benchCaseName(c), func(b *testing.B) {
+			p := New[int]()
+			runPublishBenchmark(b, p.(benchBroker), p.Close, c)
+		})
+	}
+}
+
+// BenchmarkPublishLegacy runs the same workload against legacyConfig, the single-goroutine,
+// channel-serialized router New used before chunk0-6's rewrite, so the rewrite's payoff can be measured
+// directly rather than taken on faith.
+func BenchmarkPublishLegacy(b *testing.B) {
+	for _, c := range publishBenchCases {
+		b.Run(benchCaseName(c), func(b *testing.B) {
+			cfg := newLegacyConfig[int]()
+			exit := make(chan struct{})
+			go cfg.run(exit)
+			runPublishBenchmark(b, cfg, func() { close(exit) }, c)
+		})
+	}
+}
+
+func runPublishBenchmark(b *testing.B, p benchBroker, shutdown func(), c publishBenchCase) {
+	topics := make([]string, c.topics)
+	for i := range topics {
+		topics[i] = fmt.Sprintf("topic-%d", i)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.subscribers; i++ {
+		sub, err := p.SubscribeWith(1, Options{Policy: DropNewest}, topics[i%c.topics])
+		if err != nil {
+			b.Fatal(err)
+		}
+		wg.Add(1)
+		go func(sub *Subscription[int]) {
+			defer wg.Done()
+			for range sub.Out() {
+			}
+		}(sub)
+	}
+
+	b.ResetTimer()
+	b.SetParallelism(c.publishers)
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			p.Publish(i, topics[i%c.topics])
+			i++
+		}
+	})
+	b.StopTimer()
+
+	shutdown()
+	wg.Wait()
+}
+
+// legacyConfig reimplements the pre-chunk0-6 design: every Publish and SubscribeWith hands its work to a
+// single goroutine (run) over an unbuffered channel, so the whole instance serializes on it. It exists only
+// so BenchmarkPublishLegacy has something real to compare the RWMutex-based config against.
+type legacyConfig[T any] struct {
+	publish   chan legacyPublish[T]
+	subscribe chan legacySubscribe[T]
+}
+
+type legacyPublish[T any] struct {
+	topic []string
+	v     T
+	done  chan struct{}
+}
+
+type legacySubscribe[T any] struct {
+	topic []string
+	rec   subscriberRecord[T]
+	done  chan error
+}
+
+func newLegacyConfig[T any]() *legacyConfig[T] {
+	return &legacyConfig[T]{
+		publish:   make(chan legacyPublish[T]),
+		subscribe: make(chan legacySubscribe[T]),
+	}
+}
+
+// run owns the router exclusively until exit is closed, at which point it terminates every subscriber and
+// returns.
+func (cfg *legacyConfig[T]) run(exit <-chan struct{}) {
+	rr := newLegacyRouterNode[T]()
+	for {
+		select {
+		case p := <-cfg.publish:
+			rr.publish(p.v, p.topic...)
+			close(p.done)
+		case s := <-cfg.subscribe:
+			s.done <- rr.subscribe(s.rec, s.topic...)
+		case <-exit:
+			rr.close(make(map[string]struct{}))
+			return
+		}
+	}
+}
+
+func (cfg *legacyConfig[T]) Publish(v T, topic ...string) {
+	done := make(chan struct{})
+	cfg.publish <- legacyPublish[T]{topic, v, done}
+	<-done
+}
+
+func (cfg *legacyConfig[T]) SubscribeWith(capacity int, opts Options, topic ...string) (*Subscription[T], error) {
+	sub := newSubscription[T](capacity, topic)
+	rec := subscriberRecord[T]{
+		ch:   sub.ch,
+		opts: opts,
+		sub:  sub,
+		pop: func() (T, bool) {
+			select {
+			case v := <-sub.ch:
+				return v, true
+			default:
+				var zero T
+				return zero, false
+			}
+		},
+	}
+	done := make(chan error)
+	cfg.subscribe <- legacySubscribe[T]{topic, rec, done}
+	return sub, <-done
+}
+
+type legacyRouterNode[T any] struct {
+	subscribers   map[string]subscriberRecord[T]
+	topics        map[string]*legacyRouterNode[T]
+	wildcard      *legacyRouterNode[T]
+	multiWildcard *legacyRouterNode[T]
+}
+
+func newLegacyRouterNode[T any]() *legacyRouterNode[T] {
+	return &legacyRouterNode[T]{
+		subscribers: make(map[string]subscriberRecord[T]),
+		topics:      make(map[string]*legacyRouterNode[T]),
+	}
+}
+
+func (r *legacyRouterNode[T]) subscribe(rec subscriberRecord[T], topic ...string) error {
+	if len(topic) == 0 {
+		if _, dup := r.subscribers[rec.sub.ID()]; dup {
+			return DuplicateSubscription{}
+		}
+		r.subscribers[rec.sub.ID()] = rec
+		return nil
+	}
+	switch topic[0] {
+	case "*":
+		if r.wildcard == nil {
+			r.wildcard = newLegacyRouterNode[T]()
+		}
+		return r.wildcard.subscribe(rec, topic[1:]...)
+	case "**", ">":
+		if r.multiWildcard == nil {
+			r.multiWildcard = newLegacyRouterNode[T]()
+		}
+		return r.multiWildcard.subscribe(rec)
+	default:
+		r2, ok := r.topics[topic[0]]
+		if !ok {
+			r2 = newLegacyRouterNode[T]()
+			r.topics[topic[0]] = r2
+		}
+		return r2.subscribe(rec, topic[1:]...)
+	}
+}
+
+func (r *legacyRouterNode[T]) publish(v T, topics ...string) {
+	for id, rec := range r.subscribers {
+		r.deliver(id, v, rec)
+	}
+	if r.multiWildcard != nil {
+		for id, rec := range r.multiWildcard.subscribers {
+			r.multiWildcard.deliver(id, v, rec)
+		}
+	}
+	if len(topics) == 0 {
+		return
+	}
+	if r2, ok := r.topics[topics[0]]; ok {
+		r2.publish(v, topics[1:]...)
+	}
+	if r.wildcard != nil {
+		r.wildcard.publish(v, topics[1:]...)
+	}
+}
+
+// deliver is the same policy switch as config.deliver, just running exclusively on legacyConfig.run's
+// goroutine instead of under sendMu, since nothing else can touch rec.ch concurrently here.
+func (r *legacyRouterNode[T]) deliver(id string, v T, rec subscriberRecord[T]) {
+	select {
+	case rec.ch <- v:
+		return
+	default:
+	}
+	switch rec.opts.Policy {
+	case Block:
+		if rec.opts.Timeout <= 0 {
+			rec.ch <- v
+			return
+		}
+		timer := time.NewTimer(rec.opts.Timeout)
+		defer timer.Stop()
+		select {
+		case rec.ch <- v:
+		case <-timer.C:
+		}
+	case DropOldest:
+		if rec.pop == nil {
+			return
+		}
+		if _, ok := rec.pop(); ok {
+			select {
+			case rec.ch <- v:
+			default:
+			}
+		}
+	case EvictOnOverflow:
+		r.evict(id, rec)
+	case DropNewest:
+		// the value is simply skipped
+	}
+}
+
+func (r *legacyRouterNode[T]) evict(id string, rec subscriberRecord[T]) {
+	delete(r.subscribers, id)
+	rec.sub.terminate(ErrOutOfCapacity)
+}
+
+func (r *legacyRouterNode[T]) close(closed map[string]struct{}) {
+	for id, rec := range r.subscribers {
+		if _, dup := closed[id]; dup {
+			continue
+		}
+		closed[id] = struct{}{}
+		rec.sub.terminate(nil)
+	}
+	for _, r2 := range r.topics {
+		r2.close(closed)
+	}
+	if r.wildcard != nil {
+		r.wildcard.close(closed)
+	}
+	if r.multiWildcard != nil {
+		r.multiWildcard.close(closed)
+	}
+}
@@ -0,0 +1,205 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscribeWithAfterCloseReturnsErrClosed(t *testing.T) {
+	p := New[int]()
+	p.Close()
+
+	sub, err := p.SubscribeWith(1, Options{}, "t")
+	if err != ErrClosed {
+		t.Fatalf("err = %v, want ErrClosed", err)
+	}
+	if sub != nil {
+		t.Fatalf("got non-nil Subscription %v, want nil", sub)
+	}
+}
+
+func TestDropNewestSkipsValueWhenFull(t *testing.T) {
+	p := New[int]()
+	defer p.Close()
+
+	sub, err := p.SubscribeWith(1, Options{Policy: DropNewest}, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Publish(1, "t")
+	p.Publish(2, "t") // dropped: DropNewest skips the value currently being published
+
+	if v := <-sub.Out(); v != 1 {
+		t.Fatalf("got %d, want 1", v)
+	}
+	select {
+	case v := <-sub.Out():
+		t.Fatalf("got unexpected second value %d", v)
+	default:
+	}
+}
+
+func TestDropOldestDiscardsOldestValue(t *testing.T) {
+	p := New[int]()
+	defer p.Close()
+
+	sub, err := p.SubscribeWith(1, Options{Policy: DropOldest}, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Publish(1, "t")
+	p.Publish(2, "t") // should make room by dropping 1, then deliver 2
+
+	select {
+	case v := <-sub.Out():
+		if v != 2 {
+			t.Fatalf("got %d, want 2 (the oldest value should have been dropped)", v)
+		}
+	default:
+		t.Fatal("expected a buffered value")
+	}
+	select {
+	case v := <-sub.Out():
+		t.Fatalf("got unexpected second value %d", v)
+	default:
+	}
+}
+
+func TestBlockPolicyRespectsTimeout(t *testing.T) {
+	p := New[int]()
+	defer p.Close()
+
+	const timeout = 20 * time.Millisecond
+	sub, err := p.SubscribeWith(1, Options{Policy: Block, Timeout: timeout}, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Publish(1, "t") // fills the one slot of capacity
+
+	start := time.Now()
+	p.Publish(2, "t") // nobody is draining, so this should give up after timeout rather than block forever
+	if elapsed := time.Since(start); elapsed > 10*timeout {
+		t.Fatalf("Publish took %s, want it to give up near the %s timeout", elapsed, timeout)
+	}
+
+	if v := <-sub.Out(); v != 1 {
+		t.Fatalf("got %d, want 1 (the timed-out value should have been dropped)", v)
+	}
+}
+
+func TestEvictOnOverflowRecordsErrOutOfCapacity(t *testing.T) {
+	p := New[int]()
+	defer p.Close()
+
+	sub, err := p.SubscribeWith(1, Options{Policy: EvictOnOverflow}, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Publish(1, "t")
+	p.Publish(2, "t") // nobody is draining, so this overflows and evicts the subscriber
+
+	select {
+	case <-sub.Canceled():
+	case <-time.After(time.Second):
+		t.Fatal("expected Canceled to close once the subscriber was evicted")
+	}
+	if sub.Err() != ErrOutOfCapacity {
+		t.Fatalf("Err() = %v, want ErrOutOfCapacity", sub.Err())
+	}
+}
+
+func TestWildcardMatchesOneSegmentAsAPrefix(t *testing.T) {
+	p := New[string]()
+	defer p.Close()
+
+	// Subscribing matches any published topic starting with the subscribed one, so "a", "*", "c" also
+	// matches a publish with further segments after "c".
+	sub, err := p.SubscribeWith(4, Options{}, "a", "*", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Publish("exact", "a", "b", "c")
+	p.Publish("longer", "a", "b", "c", "d")
+	p.Publish("miss-too-short", "a", "b")
+	p.Publish("miss-wrong-middle-anchor", "a", "b", "x")
+	p.Publish("miss-wrong-prefix", "x", "b", "c")
+
+	for _, want := range []string{"exact", "longer"} {
+		select {
+		case v := <-sub.Out():
+			if v != want {
+				t.Fatalf("got %q, want %q", v, want)
+			}
+		default:
+			t.Fatalf("expected %q to be delivered", want)
+		}
+	}
+	select {
+	case v := <-sub.Out():
+		t.Fatalf("got unexpected extra value %q", v)
+	default:
+	}
+}
+
+func TestMultiWildcardMatchesRemainingSegments(t *testing.T) {
+	p := New[string]()
+	defer p.Close()
+
+	sub, err := p.SubscribeWith(4, Options{}, "a", "**")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Publish("bare", "a")
+	p.Publish("one", "a", "b")
+	p.Publish("many", "a", "b", "c", "d")
+	p.Publish("miss", "x", "b")
+
+	for _, want := range []string{"bare", "one", "many"} {
+		select {
+		case v := <-sub.Out():
+			if v != want {
+				t.Fatalf("got %q, want %q", v, want)
+			}
+		default:
+			t.Fatalf("expected %q to be delivered", want)
+		}
+	}
+	select {
+	case v := <-sub.Out():
+		t.Fatalf("got unexpected extra value %q", v)
+	default:
+	}
+}
+
+func TestWildcardSubscriptionsPastFirstSegmentAreIndependent(t *testing.T) {
+	// Regression test for 7e68db2: router.topics stored child nodes by value, so subscribing a "*" or "**"
+	// under an already-subscribed topic segment mutated a copy of that node and the wildcard was silently
+	// lost.
+	p := New[string]()
+	defer p.Close()
+
+	subLiteral, err := p.SubscribeWith(1, Options{}, "a", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subWildcard, err := p.SubscribeWith(1, Options{}, "a", "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.Publish("via-wildcard", "a", "y")
+
+	select {
+	case v := <-subWildcard.Out():
+		if v != "via-wildcard" {
+			t.Fatalf("got %q, want %q", v, "via-wildcard")
+		}
+	default:
+		t.Fatal("expected the wildcard subscriber to receive a value published after a sibling literal segment")
+	}
+	select {
+	case v := <-subLiteral.Out():
+		t.Fatalf("literal subscriber should not match a different topic, got %q", v)
+	default:
+	}
+}
@@ -0,0 +1,129 @@
+package pubsub
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+)
+
+// Subscription is a handle to a single subscriber added with SubscribeWith (or, internally, Subscribe).  It
+// owns the delivery channel returned by Out, and reports why delivery to that channel stopped: normal
+// cancellation, eviction for falling behind, or pubsub shutdown.
+type Subscription[T any] struct {
+	id       string
+	topic    []string
+	ch       chan T
+	canceled chan struct{}
+	cfg      *config[T]
+
+	// sendMu guards every send to ch against a concurrent close of ch: deliver holds the read lock for as
+	// long as it might write to ch, and terminate takes the write lock before closing it, so a send and a
+	// close can never race (which would otherwise panic with "send on closed channel").
+	sendMu sync.RWMutex
+
+	mu         sync.Mutex
+	err        error
+	terminated bool
+	onCancel   []func()
+	once       sync.Once
+}
+
+func newSubscription[T any](capacity int, topic []string) *Subscription[T] {
+	return &Subscription[T]{
+		id:       newSubscriptionID(),
+		topic:    append([]string(nil), topic...),
+		ch:       make(chan T, capacity),
+		canceled: make(chan struct{}),
+	}
+}
+
+// ID returns the unique identifier assigned to this subscription when it was created.
+func (s *Subscription[T]) ID() string {
+	return s.id
+}
+
+// Out returns the channel that values are delivered on.  It is closed once the subscription is canceled,
+// evicted, or the pubsub instance it belongs to shuts down.
+func (s *Subscription[T]) Out() <-chan T {
+	return s.ch
+}
+
+// Canceled returns a channel that is closed once this subscription stops receiving values, for any reason.
+// Err distinguishes why.
+func (s *Subscription[T]) Canceled() <-chan struct{} {
+	return s.canceled
+}
+
+// Err returns the reason delivery stopped: ErrOutOfCapacity if the subscriber was evicted for being too
+// slow, ErrClosed if the pubsub instance was Closed, or nil if the subscription is still active or was
+// stopped normally with Cancel.
+func (s *Subscription[T]) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// isTerminated reports whether terminate has already run, so a caller holding sendMu knows ch is still open.
+func (s *Subscription[T]) isTerminated() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.terminated
+}
+
+// Cancel unsubscribes and closes Out.  It is safe to call more than once, and safe to call after the
+// subscription has already been terminated for another reason.
+func (s *Subscription[T]) Cancel() {
+	if s.cfg == nil {
+		s.terminate(nil)
+		return
+	}
+	s.cfg.cancel(s)
+}
+
+// OnCancel registers f to run once this subscription ends, for any reason. If it has already ended, f runs
+// immediately on the calling goroutine. Every f registered this way runs, in the order registered; this is
+// meant for bookkeeping (e.g. a Bridge telling its peer a subscription is gone), not for ordering guarantees.
+func (s *Subscription[T]) OnCancel(f func()) {
+	s.mu.Lock()
+	if s.terminated {
+		s.mu.Unlock()
+		f()
+		return
+	}
+	s.onCancel = append(s.onCancel, f)
+	s.mu.Unlock()
+}
+
+// terminate closes canceled and ch exactly once, recording err as the reason if one is given, then runs any
+// funcs registered with OnCancel. It takes sendMu's write lock before closing ch, so it waits for any send
+// in progress (see deliver) rather than racing it.
+func (s *Subscription[T]) terminate(err error) {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.err = err
+		s.terminated = true
+		callbacks := s.onCancel
+		s.onCancel = nil
+		s.mu.Unlock()
+
+		close(s.canceled)
+		s.sendMu.Lock()
+		close(s.ch)
+		s.sendMu.Unlock()
+
+		for _, f := range callbacks {
+			f()
+		}
+	})
+}
+
+// newSubscriptionID returns a random version 4 UUID, formatted per RFC 4122.
+func newSubscriptionID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
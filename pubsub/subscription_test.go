@@ -0,0 +1,154 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscriptionIDsAreUnique(t *testing.T) {
+	p := New[int]()
+	defer p.Close()
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		sub, err := p.SubscribeWith(0, Options{}, "t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[sub.ID()] {
+			t.Fatalf("ID %q reused", sub.ID())
+		}
+		seen[sub.ID()] = true
+	}
+}
+
+func TestSubscribeDeliversToTopic(t *testing.T) {
+	p := New[int]()
+	defer p.Close()
+
+	ch := make(chan int, 1)
+	if err := p.Subscribe(ch, "t"); err != nil {
+		t.Fatal(err)
+	}
+	p.Publish(1, "t")
+	p.Publish(2, "other")
+
+	select {
+	case v := <-ch:
+		if v != 1 {
+			t.Fatalf("got %d, want 1", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the subscribed topic's value")
+	}
+	select {
+	case v := <-ch:
+		t.Fatalf("got unexpected value %d for an unsubscribed topic", v)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestSubscribeSameChannelAndTopicIsDuplicate(t *testing.T) {
+	p := New[int]()
+	defer p.Close()
+
+	ch := make(chan int, 1)
+	if err := p.Subscribe(ch, "t"); err != nil {
+		t.Fatal(err)
+	}
+	err := p.Subscribe(ch, "t")
+	if _, ok := err.(DuplicateSubscription); !ok {
+		t.Fatalf("err = %v, want DuplicateSubscription", err)
+	}
+}
+
+func TestSubscribeSameChannelDifferentTopicsDoesNotDuplicate(t *testing.T) {
+	p := New[int]()
+	defer p.Close()
+
+	ch := make(chan int, 2)
+	if err := p.Subscribe(ch, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Subscribe(ch, "b"); err != nil {
+		t.Fatalf("Subscribe to a second topic with the same channel should not be a DuplicateSubscription, got %v", err)
+	}
+
+	p.Publish(1, "a")
+	p.Publish(2, "b")
+
+	got := map[int]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case v := <-ch:
+			got[v] = true
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for a value")
+		}
+	}
+	if !got[1] || !got[2] {
+		t.Fatalf("got %v, want both 1 and 2 delivered", got)
+	}
+}
+
+func TestUnsubscribeThenSubscribeAgainSucceeds(t *testing.T) {
+	p := New[int]()
+	defer p.Close()
+
+	ch := make(chan int, 1)
+	if err := p.Subscribe(ch, "t"); err != nil {
+		t.Fatal(err)
+	}
+	p.Unsubscribe(ch, "t")
+
+	if err := p.Subscribe(ch, "t"); err != nil {
+		t.Fatalf("Subscribe after Unsubscribe should succeed, got %v", err)
+	}
+}
+
+func TestUnsubscribeOfUnknownChannelDoesNothing(t *testing.T) {
+	p := New[int]()
+	defer p.Close()
+
+	ch := make(chan int, 1)
+	p.Unsubscribe(ch, "t") // never subscribed; should not panic or block
+}
+
+func TestCancelDistinguishesFromClose(t *testing.T) {
+	p := New[int]()
+	defer p.Close()
+
+	sub, err := p.SubscribeWith(0, Options{}, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub.Cancel()
+
+	select {
+	case <-sub.Canceled():
+	case <-time.After(time.Second):
+		t.Fatal("expected Canceled to close after Cancel")
+	}
+	if sub.Err() != nil {
+		t.Fatalf("Err() = %v, want nil after an ordinary Cancel", sub.Err())
+	}
+}
+
+func TestCloseRecordsErrClosed(t *testing.T) {
+	p := New[int]()
+
+	sub, err := p.SubscribeWith(0, Options{}, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+
+	select {
+	case <-sub.Canceled():
+	case <-time.After(time.Second):
+		t.Fatal("expected Canceled to close after Close")
+	}
+	if sub.Err() != ErrClosed {
+		t.Fatalf("Err() = %v, want ErrClosed after Close", sub.Err())
+	}
+}